@@ -0,0 +1,219 @@
+// Command geoip2range converts Tor's geoip file or a MaxMind GeoLite2
+// CSV export into the plain-text `start_ip,end_ip,country_code` range
+// table consumed by the rangeresolver package.
+//
+// Usage:
+//
+//	go run ./cmd/geoip2range -format=tor -in geoip -out ranges.csv
+//	go run ./cmd/geoip2range -format=maxmind -in GeoLite2-Country-Blocks-IPv4.csv -locations GeoLite2-Country-Locations-en.csv -out ranges.csv
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	format := flag.String("format", "tor", "source format: tor or maxmind")
+	in := flag.String("in", "", "input file (tor geoip file, or MaxMind *-Blocks-IPv4.csv)")
+	locations := flag.String("locations", "", "MaxMind *-Locations-en.csv (required for -format=maxmind)")
+	out := flag.String("out", "", "output range table path")
+	flag.Parse()
+
+	if *in == "" || *out == "" {
+		log.Fatal("geoip2range: -in and -out are required")
+	}
+
+	outFile, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("geoip2range: creating output: %v", err)
+	}
+	defer outFile.Close()
+
+	w := bufio.NewWriter(outFile)
+	defer w.Flush()
+
+	switch *format {
+	case "tor":
+		if err := convertTor(*in, w); err != nil {
+			log.Fatalf("geoip2range: %v", err)
+		}
+	case "maxmind":
+		if *locations == "" {
+			log.Fatal("geoip2range: -locations is required for -format=maxmind")
+		}
+		if err := convertMaxMind(*in, *locations, w); err != nil {
+			log.Fatalf("geoip2range: %v", err)
+		}
+	default:
+		log.Fatalf("geoip2range: unknown -format %q", *format)
+	}
+}
+
+// convertTor reads Tor's geoip file format, one range per line as
+// "<start_ip_int>,<end_ip_int>,<country_code>", and writes the
+// equivalent dotted-quad range table.
+func convertTor(path string, w *bufio.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			continue
+		}
+
+		startInt, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		endInt, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s,%s,%s\n",
+			uint32ToIPv4(uint32(startInt)), uint32ToIPv4(uint32(endInt)), strings.ToUpper(fields[2]))
+	}
+
+	return scanner.Err()
+}
+
+// convertMaxMind joins a GeoLite2-Country-Blocks-IPv4.csv export (network
+// in CIDR notation plus a geoname_id) against its accompanying
+// Locations csv (geoname_id -> country_iso_code) to produce the range
+// table.
+func convertMaxMind(blocksPath, locationsPath string, w *bufio.Writer) error {
+	countryByGeonameID, err := loadGeonameCountries(locationsPath)
+	if err != nil {
+		return err
+	}
+
+	blocksFile, err := os.Open(blocksPath)
+	if err != nil {
+		return err
+	}
+	defer blocksFile.Close()
+
+	r := csv.NewReader(blocksFile)
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+
+	networkCol, geonameCol := -1, -1
+	for i, col := range header {
+		switch col {
+		case "network":
+			networkCol = i
+		case "geoname_id":
+			geonameCol = i
+		}
+	}
+	if networkCol == -1 || geonameCol == -1 {
+		return fmt.Errorf("blocks csv missing network/geoname_id columns")
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("geoip2range: reading %s: %w", blocksPath, err)
+		}
+
+		cc, ok := countryByGeonameID[record[geonameCol]]
+		if !ok {
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(record[networkCol])
+		if err != nil {
+			continue
+		}
+
+		lo, hi := cidrBounds(ipNet)
+		fmt.Fprintf(w, "%s,%s,%s\n", lo, hi, cc)
+	}
+
+	return nil
+}
+
+func loadGeonameCountries(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	idCol, ccCol := -1, -1
+	for i, col := range header {
+		switch col {
+		case "geoname_id":
+			idCol = i
+		case "country_iso_code":
+			ccCol = i
+		}
+	}
+	if idCol == -1 || ccCol == -1 {
+		return nil, fmt.Errorf("locations csv missing geoname_id/country_iso_code columns")
+	}
+
+	out := make(map[string]string)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("geoip2range: reading %s: %w", path, err)
+		}
+		if record[ccCol] != "" {
+			out[record[idCol]] = record[ccCol]
+		}
+	}
+
+	return out, nil
+}
+
+func uint32ToIPv4(n uint32) string {
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).String()
+}
+
+func cidrBounds(n *net.IPNet) (lo, hi string) {
+	ip := n.IP.To4()
+	mask := n.Mask
+
+	loBytes := make(net.IP, 4)
+	hiBytes := make(net.IP, 4)
+	for i := 0; i < 4; i++ {
+		loBytes[i] = ip[i] & mask[i]
+		hiBytes[i] = ip[i] | ^mask[i]
+	}
+
+	return loBytes.String(), hiBytes.String()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+	return path
+}
+
+func TestConvertMaxMindJoinsBlocksAndLocations(t *testing.T) {
+	dir := t.TempDir()
+
+	blocksPath := writeTempFile(t, dir, "blocks.csv",
+		"network,geoname_id\n192.0.2.0/24,1\n198.51.100.0/24,2\n")
+	locationsPath := writeTempFile(t, dir, "locations.csv",
+		"geoname_id,country_iso_code\n1,US\n2,DE\n")
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+
+	if err := convertMaxMind(blocksPath, locationsPath, w); err != nil {
+		t.Fatalf("convertMaxMind: %v", err)
+	}
+	w.Flush()
+
+	got := buf.String()
+	for _, want := range []string{"192.0.2.0,192.0.2.255,US", "198.51.100.0,198.51.100.255,DE"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output %q missing row %q", got, want)
+		}
+	}
+}
+
+func TestConvertMaxMindFailsLoudlyOnMalformedRow(t *testing.T) {
+	dir := t.TempDir()
+
+	// A quoted field left unterminated makes the CSV reader return a
+	// genuine parse error partway through, which must not be swallowed
+	// as if it were a clean EOF.
+	blocksPath := writeTempFile(t, dir, "blocks.csv",
+		"network,geoname_id\n192.0.2.0/24,1\n\"198.51.100.0/24,2\n")
+	locationsPath := writeTempFile(t, dir, "locations.csv",
+		"geoname_id,country_iso_code\n1,US\n2,DE\n")
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+
+	if err := convertMaxMind(blocksPath, locationsPath, w); err == nil {
+		t.Fatal("convertMaxMind: expected an error for a malformed row, got nil")
+	}
+}
+
+func TestLoadGeonameCountriesSkipsBlankCountryCode(t *testing.T) {
+	dir := t.TempDir()
+
+	locationsPath := writeTempFile(t, dir, "locations.csv",
+		"geoname_id,country_iso_code\n1,US\n2,\n")
+
+	out, err := loadGeonameCountries(locationsPath)
+	if err != nil {
+		t.Fatalf("loadGeonameCountries: %v", err)
+	}
+
+	if out["1"] != "US" {
+		t.Errorf("out[1] = %q, want %q", out["1"], "US")
+	}
+	if _, ok := out["2"]; ok {
+		t.Errorf("out[2] present with blank country code, want absent")
+	}
+}
@@ -0,0 +1,123 @@
+// Package encoder renders geolocation results as JSON, XML, or CSV,
+// chosen by a path suffix or the Accept header, following the same
+// content-negotiation convention as freegeoip.
+package encoder
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format is a response encoding supported by the API.
+type Format string
+
+const (
+	JSON Format = "json"
+	XML  Format = "xml"
+	CSV  Format = "csv"
+)
+
+// ContentType returns the HTTP Content-Type for the format.
+func (f Format) ContentType() string {
+	switch f {
+	case XML:
+		return "application/xml; charset=utf-8"
+	case CSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// FromPath extracts the format from a `.json`/`.xml`/`.csv` suffix on
+// path, returning the trimmed path and the format, or ok=false if no
+// recognized suffix is present.
+func FromPath(path string) (trimmed string, format Format, ok bool) {
+	for _, f := range []Format{JSON, XML, CSV} {
+		suffix := "." + string(f)
+		if strings.HasSuffix(path, suffix) {
+			return strings.TrimSuffix(path, suffix), f, true
+		}
+	}
+	return path, JSON, false
+}
+
+// FromExt maps a bare extension (as captured from a `:ext` route param,
+// without the leading dot) to a Format.
+func FromExt(ext string) (format Format, ok bool) {
+	switch Format(ext) {
+	case JSON, XML, CSV:
+		return Format(ext), true
+	default:
+		return JSON, false
+	}
+}
+
+// FromAccept maps an Accept header value to a Format, defaulting to JSON
+// when nothing recognized is present.
+func FromAccept(accept string) Format {
+	switch {
+	case strings.Contains(accept, "application/xml"), strings.Contains(accept, "text/xml"):
+		return XML
+	case strings.Contains(accept, "text/csv"):
+		return CSV
+	default:
+		return JSON
+	}
+}
+
+// Negotiate resolves the response format for a request: a path suffix
+// takes priority, then the Accept header, then JSON.
+func Negotiate(path, accept string) (trimmedPath string, format Format) {
+	if trimmed, f, ok := FromPath(path); ok {
+		return trimmed, f
+	}
+	return path, FromAccept(accept)
+}
+
+// Record is implemented by payload types that know how to render
+// themselves as a CSV row.
+type Record interface {
+	CSVHeader() []string
+	CSVRow() []string
+}
+
+// WriteCSV writes records as CSV, emitting a single shared header.
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := cw.Write(records[0].CSVHeader()); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		if err := cw.Write(r.CSVRow()); err != nil {
+			return err
+		}
+	}
+
+	return cw.Error()
+}
+
+// WriteXML writes v as an XML document with a standard header.
+func WriteXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("encoder: xml encode: %w", err)
+	}
+
+	return nil
+}
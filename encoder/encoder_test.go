@@ -0,0 +1,119 @@
+package encoder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFromPath(t *testing.T) {
+	tests := []struct {
+		path        string
+		wantTrimmed string
+		wantFormat  Format
+		wantOK      bool
+	}{
+		{"/api/v1/geolocate/1.2.3.4.json", "/api/v1/geolocate/1.2.3.4", JSON, true},
+		{"/api/v1/geolocate/1.2.3.4.xml", "/api/v1/geolocate/1.2.3.4", XML, true},
+		{"/api/v1/geolocate/1.2.3.4.csv", "/api/v1/geolocate/1.2.3.4", CSV, true},
+		{"/api/v1/geolocate/1.2.3.4", "/api/v1/geolocate/1.2.3.4", JSON, false},
+	}
+
+	for _, tt := range tests {
+		trimmed, format, ok := FromPath(tt.path)
+		if trimmed != tt.wantTrimmed || format != tt.wantFormat || ok != tt.wantOK {
+			t.Errorf("FromPath(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				tt.path, trimmed, format, ok, tt.wantTrimmed, tt.wantFormat, tt.wantOK)
+		}
+	}
+}
+
+func TestFromAccept(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   Format
+	}{
+		{"application/xml", XML},
+		{"text/xml, application/xml;q=0.9", XML},
+		{"text/csv", CSV},
+		{"application/json", JSON},
+		{"", JSON},
+		{"text/html", JSON},
+	}
+
+	for _, tt := range tests {
+		if got := FromAccept(tt.accept); got != tt.want {
+			t.Errorf("FromAccept(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiatePathTakesPriorityOverAccept(t *testing.T) {
+	trimmed, format := Negotiate("/geolocate/1.2.3.4.xml", "application/json")
+	if trimmed != "/geolocate/1.2.3.4" || format != XML {
+		t.Errorf("Negotiate = (%q, %q), want (%q, %q)", trimmed, format, "/geolocate/1.2.3.4", XML)
+	}
+}
+
+func TestNegotiateFallsBackToAccept(t *testing.T) {
+	trimmed, format := Negotiate("/geolocate/1.2.3.4", "text/csv")
+	if trimmed != "/geolocate/1.2.3.4" || format != CSV {
+		t.Errorf("Negotiate = (%q, %q), want (%q, %q)", trimmed, format, "/geolocate/1.2.3.4", CSV)
+	}
+}
+
+type fakeRecord struct {
+	ip, country string
+}
+
+func (r fakeRecord) CSVHeader() []string { return []string{"ip", "country"} }
+func (r fakeRecord) CSVRow() []string    { return []string{r.ip, r.country} }
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	records := []Record{
+		fakeRecord{ip: "1.2.3.4", country: "US"},
+		fakeRecord{ip: "5.6.7.8", country: "DE"},
+	}
+
+	if err := WriteCSV(&buf, records); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+
+	want := "ip,country\n1.2.3.4,US\n5.6.7.8,DE\n"
+	if buf.String() != want {
+		t.Errorf("WriteCSV output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteCSVEmpty(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteCSV(&buf, nil); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("WriteCSV with no records wrote %q, want empty output", buf.String())
+	}
+}
+
+func TestWriteXML(t *testing.T) {
+	var buf bytes.Buffer
+
+	type payload struct {
+		IP string `xml:"ip"`
+	}
+
+	if err := WriteXML(&buf, payload{IP: "1.2.3.4"}); err != nil {
+		t.Fatalf("WriteXML: %v", err)
+	}
+
+	got := buf.String()
+	if !strings.HasPrefix(got, "<?xml") {
+		t.Errorf("WriteXML output %q missing XML header", got)
+	}
+	if !strings.Contains(got, "<ip>1.2.3.4</ip>") {
+		t.Errorf("WriteXML output %q missing encoded field", got)
+	}
+}
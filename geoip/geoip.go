@@ -0,0 +1,320 @@
+// Package geoip manages a local MaxMind GeoLite2 database and serves
+// country/city/ASN lookups from it, so GeolocationAPI can resolve IPs
+// without hitting ipstack or ip-api.com on every request.
+package geoip
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	editionCountry = "GeoLite2-Country"
+	editionCity    = "GeoLite2-City"
+	editionASN     = "GeoLite2-ASN"
+
+	refreshInterval = 7 * 24 * time.Hour
+)
+
+// permalinkFmt is MaxMind's stable download URL for a given edition. See
+// https://dev.maxmind.com/geoip/updating-databases#directly-downloading-databases
+// It's a var rather than a const so tests can point it at a local server.
+var permalinkFmt = "https://download.maxmind.com/app/geoip_download?edition_id=%s&license_key=%s&suffix=tar.gz"
+
+var (
+	dbAge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "geoip_database_age_seconds",
+		Help: "Age of the currently loaded GeoLite2 database",
+	})
+
+	lastRefresh = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "geoip_last_refresh_timestamp_seconds",
+		Help: "Unix timestamp of the last successful database refresh",
+	})
+
+	refreshFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "geoip_refresh_failures_total",
+		Help: "Total number of failed attempts to refresh the GeoLite2 database",
+	})
+)
+
+// IPInfo is the subset of location data geoip can resolve from the
+// GeoLite2 databases.
+type IPInfo struct {
+	IP          string
+	Country     string
+	City        string
+	Region      string
+	Latitude    float64
+	Longitude   float64
+	HasCoords   bool
+	TimeZone    string
+	ASN         string
+	Org         string
+	LastUpdated time.Time
+}
+
+// DB manages a MaxMind GeoLite2-Country (and optionally City/ASN) database,
+// downloading it on construction and keeping it fresh in the background.
+type DB struct {
+	accountID  string
+	licenseKey string
+	dataDir    string
+	wantCity   bool
+
+	mu         sync.RWMutex
+	country    *geoip2.Reader
+	city       *geoip2.Reader
+	asn        *geoip2.Reader
+	downloadAt time.Time
+
+	httpClient *http.Client
+}
+
+// Option configures a DB.
+type Option func(*DB)
+
+// WithCity also downloads and loads GeoLite2-City for richer lookups.
+func WithCity() Option {
+	return func(d *DB) { d.wantCity = true }
+}
+
+// New creates a DB rooted at dataDir, downloading the GeoLite2-Country
+// database immediately using the MAXMIND_ACCOUNT_ID / MAXMIND_LICENSE_KEY
+// credentials. It also starts a background goroutine that checks for
+// updates weekly.
+func New(dataDir string, opts ...Option) (*DB, error) {
+	accountID := os.Getenv("MAXMIND_ACCOUNT_ID")
+	licenseKey := os.Getenv("MAXMIND_LICENSE_KEY")
+	if licenseKey == "" {
+		return nil, fmt.Errorf("geoip: MAXMIND_LICENSE_KEY is not set")
+	}
+
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("geoip: creating data dir: %w", err)
+	}
+
+	d := &DB{
+		accountID:  accountID,
+		licenseKey: licenseKey,
+		dataDir:    dataDir,
+		httpClient: &http.Client{Timeout: 2 * time.Minute},
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	if err := d.refresh(); err != nil {
+		return nil, fmt.Errorf("geoip: initial download: %w", err)
+	}
+
+	go d.refreshLoop()
+	go d.reportAge()
+
+	return d, nil
+}
+
+func (d *DB) refreshLoop() {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := d.refresh(); err != nil {
+			refreshFailures.Inc()
+			log.Printf("geoip: background refresh failed, keeping existing database: %v", err)
+			continue
+		}
+	}
+}
+
+// reportAge keeps the geoip_database_age_seconds gauge current between
+// refreshes, so staleness is visible even if refreshes keep failing.
+func (d *DB) reportAge() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		d.mu.RLock()
+		downloadAt := d.downloadAt
+		d.mu.RUnlock()
+
+		if !downloadAt.IsZero() {
+			dbAge.Set(time.Since(downloadAt).Seconds())
+		}
+	}
+}
+
+// refresh downloads the latest tarball for each wanted edition and
+// atomically swaps the in-memory readers.
+func (d *DB) refresh() error {
+	editions := []string{editionCountry}
+	if d.wantCity {
+		editions = append(editions, editionCity, editionASN)
+	}
+
+	readers := make(map[string]*geoip2.Reader, len(editions))
+	for _, edition := range editions {
+		path, err := d.download(edition)
+		if err != nil {
+			return fmt.Errorf("downloading %s: %w", edition, err)
+		}
+
+		r, err := geoip2.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", edition, err)
+		}
+		readers[edition] = r
+	}
+
+	d.mu.Lock()
+	old := []*geoip2.Reader{d.country, d.city, d.asn}
+	d.country = readers[editionCountry]
+	d.city = readers[editionCity]
+	d.asn = readers[editionASN]
+	d.downloadAt = time.Now()
+	d.mu.Unlock()
+
+	lastRefresh.Set(float64(time.Now().Unix()))
+	dbAge.Set(0)
+
+	for _, r := range old {
+		if r != nil {
+			r.Close()
+		}
+	}
+
+	return nil
+}
+
+// download fetches the tarball for edition and extracts the .mmdb into
+// d.dataDir, returning its path.
+func (d *DB) download(edition string) (string, error) {
+	url := fmt.Sprintf(permalinkFmt, edition, d.licenseKey)
+
+	resp, err := d.httpClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("no .mmdb file found in tarball for %s", edition)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if !strings.HasSuffix(hdr.Name, ".mmdb") {
+			continue
+		}
+
+		// Extract to a temporary file and rename it into place, so the file
+		// behind the currently loaded reader is never truncated or left
+		// half-written if the download fails.
+		dest := filepath.Join(d.dataDir, edition+".mmdb")
+		f, err := os.CreateTemp(d.dataDir, edition+".*.tmp")
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return "", err
+		}
+		f.Close()
+
+		if err := os.Rename(f.Name(), dest); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+
+		return dest, nil
+	}
+}
+
+// Lookup resolves ip against the loaded GeoLite2 databases.
+func (d *DB) Lookup(ip net.IP) (*IPInfo, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.country == nil {
+		return nil, fmt.Errorf("geoip: database not loaded")
+	}
+
+	info := &IPInfo{
+		IP:          ip.String(),
+		LastUpdated: d.downloadAt,
+	}
+
+	country, err := d.country.Country(ip)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: country lookup: %w", err)
+	}
+	info.Country = country.Country.Names["en"]
+
+	if d.city != nil {
+		city, err := d.city.City(ip)
+		if err == nil {
+			info.City = city.City.Names["en"]
+			if len(city.Subdivisions) > 0 {
+				info.Region = city.Subdivisions[0].Names["en"]
+			}
+			info.Latitude = city.Location.Latitude
+			info.Longitude = city.Location.Longitude
+			info.HasCoords = true
+			info.TimeZone = city.Location.TimeZone
+		}
+	}
+
+	if d.asn != nil {
+		asn, err := d.asn.ASN(ip)
+		if err == nil {
+			info.ASN = fmt.Sprintf("AS%d", asn.AutonomousSystemNumber)
+			info.Org = asn.AutonomousSystemOrganization
+		}
+	}
+
+	return info, nil
+}
+
+// Close releases the underlying mmdb file handles.
+func (d *DB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, r := range []*geoip2.Reader{d.country, d.city, d.asn} {
+		if r != nil {
+			r.Close()
+		}
+	}
+	return nil
+}
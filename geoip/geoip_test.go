@@ -0,0 +1,134 @@
+package geoip
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withTestPermalink points permalinkFmt at srv for the duration of the
+// test, restoring the real MaxMind URL format on cleanup.
+func withTestPermalink(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	orig := permalinkFmt
+	permalinkFmt = srv.URL + "?edition_id=%s&license_key=%s"
+	t.Cleanup(func() { permalinkFmt = orig })
+}
+
+// tarGzWithMMDB builds a gzip'd tarball containing a single file named
+// name holding contents, mirroring the shape of MaxMind's download.
+func tarGzWithMMDB(t *testing.T, name, contents string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	if err := tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(contents)), Mode: 0o644}); err != nil {
+		t.Fatalf("writing tar header: %v", err)
+	}
+	if _, err := tw.Write([]byte(contents)); err != nil {
+		t.Fatalf("writing tar contents: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("closing gzip writer: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDownloadExtractsMMDBFromTarball(t *testing.T) {
+	tarball := tarGzWithMMDB(t, "GeoLite2-Country_20240101/GeoLite2-Country.mmdb", "fake mmdb contents")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball)
+	}))
+	defer srv.Close()
+
+	withTestPermalink(t, srv)
+
+	d := &DB{
+		licenseKey: "testkey",
+		dataDir:    t.TempDir(),
+		httpClient: srv.Client(),
+	}
+
+	path, err := d.download("GeoLite2-Country")
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading extracted file: %v", err)
+	}
+	if string(got) != "fake mmdb contents" {
+		t.Errorf("extracted contents = %q, want %q", got, "fake mmdb contents")
+	}
+	if filepath.Base(path) != "GeoLite2-Country.mmdb" {
+		t.Errorf("extracted path = %q, want basename %q", path, "GeoLite2-Country.mmdb")
+	}
+}
+
+func TestDownloadFailsOnNonOKStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	withTestPermalink(t, srv)
+
+	d := &DB{licenseKey: "testkey", dataDir: t.TempDir(), httpClient: srv.Client()}
+
+	if _, err := d.download("GeoLite2-Country"); err == nil {
+		t.Fatal("download: expected an error for a non-200 response, got nil")
+	}
+}
+
+func TestDownloadFailsWhenTarballHasNoMMDB(t *testing.T) {
+	tarball := tarGzWithMMDB(t, "GeoLite2-Country_20240101/README.txt", "not an mmdb")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball)
+	}))
+	defer srv.Close()
+	withTestPermalink(t, srv)
+
+	d := &DB{licenseKey: "testkey", dataDir: t.TempDir(), httpClient: srv.Client()}
+
+	if _, err := d.download("GeoLite2-Country"); err == nil {
+		t.Fatal("download: expected an error when the tarball has no .mmdb file, got nil")
+	}
+}
+
+func TestDownloadRequestIncludesEditionAndLicenseKey(t *testing.T) {
+	var gotQuery url.Values
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		w.Write(tarGzWithMMDB(t, "x/GeoLite2-City.mmdb", "contents"))
+	}))
+	defer srv.Close()
+	withTestPermalink(t, srv)
+
+	d := &DB{licenseKey: "super-secret", dataDir: t.TempDir(), httpClient: srv.Client()}
+
+	if _, err := d.download(editionCity); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	if gotQuery.Get("edition_id") != editionCity {
+		t.Errorf("edition_id = %q, want %q", gotQuery.Get("edition_id"), editionCity)
+	}
+	if gotQuery.Get("license_key") != "super-secret" {
+		t.Errorf("license_key = %q, want %q", gotQuery.Get("license_key"), "super-secret")
+	}
+}
@@ -0,0 +1,194 @@
+// Package kdtree implements a 2-D KD-tree over latitude/longitude points,
+// used to find the N nearest registered points-of-presence to a
+// geolocated IP by great-circle distance.
+package kdtree
+
+import (
+	"container/heap"
+	"math"
+)
+
+// earthRadiusKm is the mean radius used for haversine distance.
+const earthRadiusKm = 6371.0
+
+// Point is a named location registered in the tree.
+type Point struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+type node struct {
+	point       Point
+	axis        int // 0 = latitude, 1 = longitude
+	left, right *node
+}
+
+// Tree is a 2-D KD-tree over Points, split on alternating axes.
+type Tree struct {
+	root *node
+}
+
+// New builds a Tree over points via recursive median-split on
+// alternating axes. It is rebuilt (not updated in place) whenever the
+// set of registered endpoints changes.
+func New(points []Point) *Tree {
+	pts := make([]Point, len(points))
+	copy(pts, points)
+	return &Tree{root: build(pts, 0)}
+}
+
+func build(points []Point, depth int) *node {
+	if len(points) == 0 {
+		return nil
+	}
+
+	axis := depth % 2
+	sortByAxis(points, axis)
+
+	mid := len(points) / 2
+	n := &node{point: points[mid], axis: axis}
+	n.left = build(points[:mid], depth+1)
+	n.right = build(points[mid+1:], depth+1)
+
+	return n
+}
+
+// sortByAxis sorts points in place by latitude (axis 0) or longitude
+// (axis 1), using a plain insertion sort since POP counts are small.
+func sortByAxis(points []Point, axis int) {
+	key := func(p Point) float64 {
+		if axis == 0 {
+			return p.Latitude
+		}
+		return p.Longitude
+	}
+
+	for i := 1; i < len(points); i++ {
+		for j := i; j > 0 && key(points[j]) < key(points[j-1]); j-- {
+			points[j], points[j-1] = points[j-1], points[j]
+		}
+	}
+}
+
+// candidate is a search result tracked in the bounded max-heap, ordered
+// so the worst (largest-distance) candidate sits at the heap's root and
+// is the first one evicted once the heap is full.
+type candidate struct {
+	point    Point
+	distance float64
+}
+
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].distance > h[j].distance }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// Nearest returns the n registered points closest to (lat, lon) by
+// great-circle distance, nearest first.
+func (t *Tree) Nearest(lat, lon float64, n int) []Point {
+	if t.root == nil || n <= 0 {
+		return nil
+	}
+
+	h := &maxHeap{}
+	heap.Init(h)
+
+	search(t.root, lat, lon, n, h)
+
+	results := make([]Point, h.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		results[i] = heap.Pop(h).(candidate).point
+	}
+
+	return results
+}
+
+func search(n *node, lat, lon float64, want int, h *maxHeap) {
+	if n == nil {
+		return
+	}
+
+	d := haversine(lat, lon, n.point.Latitude, n.point.Longitude)
+
+	if h.Len() < want {
+		heap.Push(h, candidate{point: n.point, distance: d})
+	} else if d < (*h)[0].distance {
+		heap.Pop(h)
+		heap.Push(h, candidate{point: n.point, distance: d})
+	}
+
+	var query, nodeVal float64
+	if n.axis == 0 {
+		query, nodeVal = lat, n.point.Latitude
+	} else {
+		query, nodeVal = lon, n.point.Longitude
+	}
+
+	near, far := n.left, n.right
+	if query > nodeVal {
+		near, far = n.right, n.left
+	}
+
+	search(near, lat, lon, want, h)
+
+	// Only descend into the far subtree if its splitting hyperplane is
+	// closer than our current worst candidate; otherwise nothing on the
+	// far side can beat what we already have.
+	planeDist := haversineAxis(n.axis, lat, query, nodeVal)
+	if h.Len() < want || planeDist < (*h)[0].distance {
+		search(far, lat, lon, want, h)
+	}
+}
+
+// haversineAxis returns a lower bound on the great-circle distance from
+// the query to any point on the far side of a split, used when deciding
+// whether to prune the far subtree. For a longitude split the far side
+// is the lune between meridian b and the antimeridian, so the bound is
+// the distance to the nearer of those two half-meridians, computed at
+// the query's actual latitude. Anything larger (such as the distance
+// along the query's parallel, or one that ignores the antimeridian)
+// would overestimate and prune real nearest neighbors.
+func haversineAxis(axis int, lat, a, b float64) float64 {
+	if axis == 0 {
+		return haversine(a, 0, b, 0)
+	}
+	rad := math.Pi / 180
+	best := math.Inf(1)
+	for _, meridian := range []float64{b, 180} {
+		dLon := math.Abs(math.Mod(a-meridian, 360))
+		if dLon > 180 {
+			dLon = 360 - dLon
+		}
+		d := (90 - math.Abs(lat)) * rad // nearest pole
+		if dLon < 90 {
+			d = math.Asin(math.Cos(lat*rad) * math.Sin(dLon*rad))
+		}
+		best = math.Min(best, earthRadiusKm*d)
+	}
+	return best
+}
+
+// haversine returns the great-circle distance in km between two
+// lat/long points given in degrees.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return earthRadiusKm * c
+}
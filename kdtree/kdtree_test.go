@@ -0,0 +1,126 @@
+package kdtree
+
+import (
+	"testing"
+)
+
+// bruteNearest finds the n closest points to (lat, lon) by scanning all
+// of them, as a reference implementation to check the tree against.
+func bruteNearest(points []Point, lat, lon float64, n int) []Point {
+	type scored struct {
+		point    Point
+		distance float64
+	}
+
+	scoredPoints := make([]scored, len(points))
+	for i, p := range points {
+		scoredPoints[i] = scored{point: p, distance: haversine(lat, lon, p.Latitude, p.Longitude)}
+	}
+
+	for i := 1; i < len(scoredPoints); i++ {
+		for j := i; j > 0 && scoredPoints[j].distance < scoredPoints[j-1].distance; j-- {
+			scoredPoints[j], scoredPoints[j-1] = scoredPoints[j-1], scoredPoints[j]
+		}
+	}
+
+	if n > len(scoredPoints) {
+		n = len(scoredPoints)
+	}
+
+	out := make([]Point, n)
+	for i := 0; i < n; i++ {
+		out[i] = scoredPoints[i].point
+	}
+	return out
+}
+
+// TestNearestMatchesBruteForce checks the KD-tree against a linear scan
+// for query points at a range of latitudes, including high latitudes
+// where a longitude split's bounding-hyperplane distance differs
+// significantly from its equatorial value.
+func TestNearestMatchesBruteForce(t *testing.T) {
+	points := []Point{
+		{Name: "sfo", Latitude: 37.6213, Longitude: -122.3790},
+		{Name: "lhr", Latitude: 51.4700, Longitude: -0.4543},
+		{Name: "nrt", Latitude: 35.7720, Longitude: 140.3929},
+		{Name: "syd", Latitude: -33.9399, Longitude: 151.1753},
+		{Name: "gru", Latitude: -23.4356, Longitude: -46.4731},
+		{Name: "osl", Latitude: 60.1976, Longitude: 11.1004},
+		{Name: "yyz", Latitude: 43.6777, Longitude: -79.6248},
+		{Name: "cpt", Latitude: -33.9715, Longitude: 18.6021},
+		{Name: "svo", Latitude: 55.9726, Longitude: 37.4146},
+		{Name: "hel", Latitude: 60.3172, Longitude: 24.9633},
+	}
+
+	tree := New(points)
+
+	queries := []struct {
+		name     string
+		lat, lon float64
+	}{
+		{"equator", 0.5, 10.0},
+		{"mid-latitude", 48.8566, 2.3522},
+		{"high-latitude", 64.1466, -21.9426},
+		{"southern-hemisphere", -34.6037, -58.3816},
+	}
+
+	for _, q := range queries {
+		t.Run(q.name, func(t *testing.T) {
+			got := tree.Nearest(q.lat, q.lon, 3)
+			want := bruteNearest(points, q.lat, q.lon, 3)
+
+			if len(got) != len(want) {
+				t.Fatalf("got %d results, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].Name != want[i].Name {
+					t.Errorf("result %d = %q, want %q (got %+v, want %+v)", i, got[i].Name, want[i].Name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNearestEmptyTree(t *testing.T) {
+	tree := New(nil)
+	if got := tree.Nearest(0, 0, 3); got != nil {
+		t.Errorf("Nearest on empty tree = %v, want nil", got)
+	}
+}
+
+// TestNearestHighLatitudePruning pins down a known-bad case: a
+// longitude-axis split whose bounding-hyperplane distance was computed
+// at the equator overestimates the true minimum distance away from the
+// equator, causing search() to over-prune the far subtree and drop a
+// true nearest neighbor. All points and the query sit in the 55-65N
+// band where that overestimate is large enough to matter.
+func TestNearestHighLatitudePruning(t *testing.T) {
+	points := []Point{
+		{Name: "p0", Latitude: 59.80565383904614, Longitude: 134.7376757172629},
+		{Name: "p1", Latitude: 64.1471180287367, Longitude: 167.02593290654113},
+		{Name: "p2", Latitude: 57.72962271106299, Longitude: 84.45299453360502},
+		{Name: "p3", Latitude: 59.43317529922179, Longitude: 74.49567830459944},
+		{Name: "p4", Latitude: 63.1884811443169, Longitude: -123.73604808711096},
+		{Name: "p5", Latitude: 57.14062949383519, Longitude: 105.84555248872266},
+		{Name: "p6", Latitude: 57.7338824358203, Longitude: 177.6970805794997},
+		{Name: "p7", Latitude: 63.52610278523445, Longitude: -109.43853952200786},
+		{Name: "p8", Latitude: 61.7263909766024, Longitude: 10.47039311496411},
+		{Name: "p9", Latitude: 58.30365328396931, Longitude: 162.73926878742327},
+		{Name: "p10", Latitude: 59.13538821316229, Longitude: 28.514526836103897},
+		{Name: "p11", Latitude: 55.13738758016676, Longitude: 173.53316998846168},
+	}
+
+	tree := New(points)
+
+	got := tree.Nearest(58.43650452843216, -129.91258722971514, 3)
+	want := []string{"p4", "p7", "p6"}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d", len(got), len(want))
+	}
+	for i, name := range want {
+		if got[i].Name != name {
+			t.Errorf("result %d = %q, want %q (got %+v)", i, got[i].Name, name, got)
+		}
+	}
+}
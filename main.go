@@ -3,11 +3,15 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,6 +20,15 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+
+	"ip-location-finder/encoder"
+	"ip-location-finder/geoip"
+	"ip-location-finder/kdtree"
+	"ip-location-finder/middleware"
+	"ip-location-finder/rangeresolver"
+	"ip-location-finder/ratelimit"
 )
 
 var (
@@ -24,7 +37,7 @@ var (
 			Name: "ip_geolocation_requests_total",
 			Help: "Total number of IP geolocation requests",
 		},
-		[]string{"country", "source"},
+		[]string{"country", "source", "endpoint"},
 	)
 
 	requestDuration = promauto.NewHistogramVec(
@@ -51,18 +64,183 @@ var (
 )
 
 type IPInfo struct {
-	IP       string    `json:"ip" db:"ip"`
-	Country  string    `json:"country" db:"country"`
-	CachedAt time.Time `json:"cached_at" db:"cached_at"`
+	IP           string    `db:"ip"`
+	Country      string    `db:"country"`
+	City         string    `db:"city"`
+	Region       string    `db:"region"`
+	Latitude     float64   `db:"latitude"`
+	Longitude    float64   `db:"longitude"`
+	TimeZone     string    `db:"time_zone"`
+	ASN          string    `db:"asn"`
+	Organization string    `db:"organization"`
+	CachedAt     time.Time `db:"cached_at"`
+
+	// hasCoords records whether Latitude/Longitude were actually resolved,
+	// so a genuine (0, 0) location isn't confused with "no coordinates"
+	// the way comparing against the float zero value would. MarshalJSON
+	// and MarshalXML key off it rather than the float zero value, so it
+	// also drives what the wire format omits.
+	hasCoords bool
+}
+
+// ipInfoWire mirrors IPInfo's wire fields, with Latitude/Longitude as
+// pointers so MarshalJSON/MarshalXML can omit them based on hasCoords
+// instead of the ambiguous float64 zero value.
+type ipInfoWire struct {
+	IP           string    `json:"ip" xml:"ip"`
+	Country      string    `json:"country" xml:"country"`
+	City         string    `json:"city,omitempty" xml:"city,omitempty"`
+	Region       string    `json:"region,omitempty" xml:"region,omitempty"`
+	Latitude     *float64  `json:"latitude,omitempty" xml:"latitude,omitempty"`
+	Longitude    *float64  `json:"longitude,omitempty" xml:"longitude,omitempty"`
+	TimeZone     string    `json:"time_zone,omitempty" xml:"time_zone,omitempty"`
+	ASN          string    `json:"asn,omitempty" xml:"asn,omitempty"`
+	Organization string    `json:"organization,omitempty" xml:"organization,omitempty"`
+	CachedAt     time.Time `json:"cached_at" xml:"cached_at"`
+}
+
+func (i IPInfo) wire() ipInfoWire {
+	w := ipInfoWire{
+		IP:           i.IP,
+		Country:      i.Country,
+		City:         i.City,
+		Region:       i.Region,
+		TimeZone:     i.TimeZone,
+		ASN:          i.ASN,
+		Organization: i.Organization,
+		CachedAt:     i.CachedAt,
+	}
+	if i.hasCoords {
+		w.Latitude = &i.Latitude
+		w.Longitude = &i.Longitude
+	}
+	return w
+}
+
+// MarshalJSON omits latitude/longitude when they weren't actually
+// resolved, rather than relying on omitempty against the float64 zero
+// value (which would also hide a genuine (0, 0) location).
+func (i IPInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.wire())
+}
+
+// MarshalXML mirrors MarshalJSON's omission rule for the XML encoding.
+// The element name is fixed at "ip_info" rather than read off an
+// XMLName field, since the xml package ignores XMLName on types that
+// implement Marshaler.
+func (i IPInfo) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "ip_info"}
+	return e.EncodeElement(i.wire(), start)
+}
+
+// CSVHeader and CSVRow implement encoder.Record so IPInfo can be streamed
+// out as CSV.
+func (i IPInfo) CSVHeader() []string {
+	return []string{"ip", "country", "city", "region", "latitude", "longitude", "time_zone", "asn", "organization", "cached_at"}
+}
+
+func (i IPInfo) CSVRow() []string {
+	return []string{
+		i.IP,
+		i.Country,
+		i.City,
+		i.Region,
+		strconv.FormatFloat(i.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(i.Longitude, 'f', -1, 64),
+		i.TimeZone,
+		i.ASN,
+		i.Organization,
+		i.CachedAt.Format(time.RFC3339),
+	}
+}
+
+// ipInfoList wraps a slice of IPInfo so it marshals to XML with a single
+// root element instead of a bare repeated sequence.
+type ipInfoList struct {
+	XMLName xml.Name `xml:"ip_infos"`
+	Count   int      `xml:"count,attr"`
+	Items   []IPInfo `xml:"ip_info"`
+}
+
+func asRecords(items []IPInfo) []encoder.Record {
+	records := make([]encoder.Record, len(items))
+	for i, item := range items {
+		records[i] = item
+	}
+	return records
+}
+
+// renderOne writes a single IPInfo in the negotiated format.
+func renderOne(c *gin.Context, status int, format encoder.Format, info *IPInfo) {
+	switch format {
+	case encoder.XML:
+		c.Header("Content-Type", format.ContentType())
+		c.Status(status)
+		if err := encoder.WriteXML(c.Writer, info); err != nil {
+			log.Printf("encoder: failed to write XML: %v", err)
+		}
+	case encoder.CSV:
+		c.Header("Content-Type", format.ContentType())
+		c.Status(status)
+		if err := encoder.WriteCSV(c.Writer, asRecords([]IPInfo{*info})); err != nil {
+			log.Printf("encoder: failed to write CSV: %v", err)
+		}
+	default:
+		c.JSON(status, info)
+	}
+}
+
+// renderList writes a slice of IPInfo in the negotiated format, falling
+// back to jsonPayload for the JSON case so existing response shapes
+// (e.g. the {"cached_ips": ..., "count": ...} envelope) are preserved.
+func renderList(c *gin.Context, status int, format encoder.Format, items []IPInfo, jsonPayload gin.H) {
+	switch format {
+	case encoder.XML:
+		c.Header("Content-Type", format.ContentType())
+		c.Status(status)
+		list := ipInfoList{Count: len(items), Items: items}
+		if err := encoder.WriteXML(c.Writer, list); err != nil {
+			log.Printf("encoder: failed to write XML: %v", err)
+		}
+	case encoder.CSV:
+		c.Header("Content-Type", format.ContentType())
+		c.Status(status)
+		if err := encoder.WriteCSV(c.Writer, asRecords(items)); err != nil {
+			log.Printf("encoder: failed to write CSV: %v", err)
+		}
+	default:
+		c.JSON(status, jsonPayload)
+	}
 }
 
 type IPStackResponse struct {
-	CountryName string `json:"country_name"`
+	CountryName string  `json:"country_name"`
+	RegionName  string  `json:"region_name"`
+	City        string  `json:"city"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Connection  struct {
+		ASN int    `json:"asn"`
+		ISP string `json:"isp"`
+	} `json:"connection"`
 }
 
 type GeolocationAPI struct {
-	db     *sql.DB
-	apiKey string
+	db        *sql.DB
+	apiKey    string
+	geoDB     *geoip.DB
+	countryDB rangeresolver.Resolver
+
+	endpointsMu sync.RWMutex
+	endpoints   *kdtree.Tree
+}
+
+// Endpoint is a named point-of-presence registered for nearest-endpoint
+// routing.
+type Endpoint struct {
+	Name      string  `json:"name" db:"name"`
+	Latitude  float64 `json:"latitude" db:"latitude"`
+	Longitude float64 `json:"longitude" db:"longitude"`
 }
 
 func main() {
@@ -81,7 +259,45 @@ func main() {
 		apiKey: os.Getenv("IPSTACK_API_KEY"),
 	}
 
-	r := gin.Default()
+	if dataDir := os.Getenv("GEOIP_DATA_DIR"); dataDir != "" {
+		var geoOpts []geoip.Option
+		if wantCity, _ := strconv.ParseBool(os.Getenv("GEOIP_WANT_CITY")); wantCity {
+			geoOpts = append(geoOpts, geoip.WithCity())
+		}
+
+		geoDB, err := geoip.New(dataDir, geoOpts...)
+		if err != nil {
+			log.Printf("geoip: disabled, falling back to external APIs: %v", err)
+		} else {
+			defer geoDB.Close()
+			api.geoDB = geoDB
+		}
+	}
+
+	if rangeTablePath := os.Getenv("COUNTRY_RANGE_TABLE"); rangeTablePath != "" {
+		table, err := rangeresolver.Load(rangeTablePath)
+		if err != nil {
+			log.Printf("rangeresolver: disabled, falling back to external APIs: %v", err)
+		} else {
+			api.countryDB = table
+		}
+	}
+
+	if err := api.reloadEndpoints(); err != nil {
+		log.Printf("Failed to load registered endpoints: %v", err)
+	}
+
+	limiter, whitelist, trustedProxies, err := buildRateLimiter()
+	if err != nil {
+		log.Fatal("Failed to configure rate limiter:", err)
+	}
+
+	accessLogger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(middleware.RequestID())
+	r.Use(middleware.AccessLog(accessLogger))
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
@@ -90,16 +306,28 @@ func main() {
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	v1 := r.Group("/api/v1")
+	v1.Use(middleware.CORS(middleware.CORSConfigFromEnv()))
+	v1.Use(ratelimit.Middleware(limiter, whitelist, trustedProxies))
+	// Gin never routes OPTIONS to a handler unless one is registered, so
+	// without this the CORS middleware's preflight handling above is
+	// unreachable and every preflighted cross-origin request 404s before
+	// it gets there.
+	v1.OPTIONS("/*any", func(c *gin.Context) {})
 	{
 		v1.GET("/geolocate/:ip", api.geolocateIP)
 
 		v1.POST("/geolocate/bulk", api.geolocateBulkIPs)
 
 		v1.GET("/cached", api.getCachedIPs)
+		v1.GET("/cached.:ext", api.getCachedIPs)
 
 		v1.DELETE("/cache/:ip", api.clearCacheIP)
 
 		v1.DELETE("/cache", api.clearAllCache)
+
+		v1.POST("/endpoints", api.registerEndpoints)
+
+		v1.GET("/nearest/:ip", api.nearestEndpoints)
 	}
 
 	port := os.Getenv("PORT")
@@ -157,14 +385,82 @@ func initDB() (*sql.DB, error) {
 		return nil, err
 	}
 
+	// Added for the richer IPInfo payload (city/region/coordinates/timezone/ASN);
+	// all nullable so existing rows and clients are unaffected.
+	migrateColumnsQuery := `
+	ALTER TABLE ip_locations ADD COLUMN IF NOT EXISTS city VARCHAR(100);
+	ALTER TABLE ip_locations ADD COLUMN IF NOT EXISTS region VARCHAR(100);
+	ALTER TABLE ip_locations ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;
+	ALTER TABLE ip_locations ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
+	ALTER TABLE ip_locations ADD COLUMN IF NOT EXISTS time_zone VARCHAR(100);
+	ALTER TABLE ip_locations ADD COLUMN IF NOT EXISTS asn VARCHAR(20);
+	ALTER TABLE ip_locations ADD COLUMN IF NOT EXISTS organization VARCHAR(255);
+	`
+
+	if _, err := db.Exec(migrateColumnsQuery); err != nil {
+		return nil, err
+	}
+
+	createEndpointsQuery := `
+	CREATE TABLE IF NOT EXISTS endpoints (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		latitude DOUBLE PRECISION NOT NULL,
+		longitude DOUBLE PRECISION NOT NULL
+	);
+	`
+
+	if _, err := db.Exec(createEndpointsQuery); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
+// buildRateLimiter selects the rate limiter backend from
+// RATE_LIMIT_BACKEND ("lru", the default, or "redis"), wires up the CIDR
+// whitelist from RATE_LIMIT_WHITELIST, and the trusted-proxy CIDRs from
+// RATE_LIMIT_TRUSTED_PROXIES that are allowed to supply
+// X-Forwarded-For.
+func buildRateLimiter() (ratelimit.Limiter, *ratelimit.Whitelist, *ratelimit.Whitelist, error) {
+	limit := 1000
+	if v := os.Getenv("RATE_LIMIT_PER_HOUR"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid RATE_LIMIT_PER_HOUR: %w", err)
+		}
+		limit = parsed
+	}
+
+	var whitelistEntries []string
+	if v := os.Getenv("RATE_LIMIT_WHITELIST"); v != "" {
+		whitelistEntries = strings.Split(v, ",")
+	}
+	whitelist := ratelimit.NewWhitelist(whitelistEntries)
+
+	var trustedProxyEntries []string
+	if v := os.Getenv("RATE_LIMIT_TRUSTED_PROXIES"); v != "" {
+		trustedProxyEntries = strings.Split(v, ",")
+	}
+	trustedProxies := ratelimit.NewWhitelist(trustedProxyEntries)
+
+	if os.Getenv("RATE_LIMIT_BACKEND") == "redis" {
+		client := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR")})
+		return ratelimit.NewRedisLimiter(client, limit), whitelist, trustedProxies, nil
+	}
+
+	limiter, err := ratelimit.NewLRULimiter(limit, 10000)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return limiter, whitelist, trustedProxies, nil
+}
+
 func (api *GeolocationAPI) geolocateIP(c *gin.Context) {
 	timer := prometheus.NewTimer(requestDuration.WithLabelValues("api"))
 	defer timer.ObserveDuration()
 
-	ipStr := c.Param("ip")
+	ipStr, format := encoder.Negotiate(c.Param("ip"), c.GetHeader("Accept"))
 
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
@@ -174,38 +470,51 @@ func (api *GeolocationAPI) geolocateIP(c *gin.Context) {
 
 	if info, found := api.getFromCache(ipStr); found {
 		cacheHits.Inc()
-		requestsTotal.WithLabelValues(info.Country, "cache").Inc()
-		c.JSON(http.StatusOK, info)
+		requestsTotal.WithLabelValues(info.Country, "cache", c.FullPath()).Inc()
+		middleware.SetResolvedCountry(c, info.Country)
+		renderOne(c, http.StatusOK, format, info)
 		return
 	}
 
 	cacheMisses.Inc()
 
-	country, err := api.getCountryFromAPI(ipStr)
+	resolved, source, err := api.getCountryFromAPI(ipStr)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get location"})
 		return
 	}
 
-	info := &IPInfo{
-		IP:       ipStr,
-		Country:  country,
-		CachedAt: time.Now(),
-	}
+	info := &resolved
+	info.IP = ipStr
+	info.CachedAt = time.Now()
 
 	if err := api.saveToCache(info); err != nil {
 		log.Printf("Failed to save to cache: %v", err)
 	}
 
-	requestsTotal.WithLabelValues(country, "external_api").Inc()
-	c.JSON(http.StatusOK, info)
+	requestsTotal.WithLabelValues(info.Country, source, c.FullPath()).Inc()
+	middleware.SetResolvedCountry(c, info.Country)
+	renderOne(c, http.StatusOK, format, info)
 }
 
 func (api *GeolocationAPI) getFromCache(ip string) (*IPInfo, bool) {
-	query := `SELECT ip, country, cached_at FROM ip_locations WHERE ip = $1`
+	query := `SELECT ip, country, city, region, latitude, longitude, time_zone, asn, organization, cached_at
+			  FROM ip_locations WHERE ip = $1`
+
+	var (
+		info      IPInfo
+		city      sql.NullString
+		region    sql.NullString
+		latitude  sql.NullFloat64
+		longitude sql.NullFloat64
+		timeZone  sql.NullString
+		asn       sql.NullString
+		org       sql.NullString
+	)
 
-	var info IPInfo
-	err := api.db.QueryRow(query, ip).Scan(&info.IP, &info.Country, &info.CachedAt)
+	err := api.db.QueryRow(query, ip).Scan(
+		&info.IP, &info.Country, &city, &region, &latitude, &longitude, &timeZone, &asn, &org, &info.CachedAt,
+	)
 	if err != nil {
 		return nil, false
 	}
@@ -214,64 +523,162 @@ func (api *GeolocationAPI) getFromCache(ip string) (*IPInfo, bool) {
 		return nil, false
 	}
 
+	info.City = city.String
+	info.Region = region.String
+	info.Latitude = latitude.Float64
+	info.Longitude = longitude.Float64
+	info.hasCoords = latitude.Valid && longitude.Valid
+	info.TimeZone = timeZone.String
+	info.ASN = asn.String
+	info.Organization = org.String
+
 	return &info, true
 }
 
 func (api *GeolocationAPI) saveToCache(info *IPInfo) error {
-	query := `INSERT INTO ip_locations (ip, country, cached_at) 
-			  VALUES ($1, $2, $3) 
-			  ON CONFLICT (ip) 
-			  DO UPDATE SET country = $2, cached_at = $3`
-
-	_, err := api.db.Exec(query, info.IP, info.Country, info.CachedAt)
+	query := `INSERT INTO ip_locations (ip, country, city, region, latitude, longitude, time_zone, asn, organization, cached_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			  ON CONFLICT (ip)
+			  DO UPDATE SET country = $2, city = $3, region = $4, latitude = $5, longitude = $6,
+			                time_zone = $7, asn = $8, organization = $9, cached_at = $10`
+
+	latitude, longitude := nullIfNoCoords(info.Latitude, info.hasCoords), nullIfNoCoords(info.Longitude, info.hasCoords)
+
+	_, err := api.db.Exec(query,
+		info.IP, info.Country, nullIfEmpty(info.City), nullIfEmpty(info.Region),
+		latitude, longitude, nullIfEmpty(info.TimeZone),
+		nullIfEmpty(info.ASN), nullIfEmpty(info.Organization), info.CachedAt,
+	)
 	return err
 }
 
-func (api *GeolocationAPI) getCountryFromAPI(ip string) (string, error) {
+// nullIfEmpty lets an empty optional string be stored as SQL NULL rather
+// than an empty string, so omitempty on read-back behaves correctly.
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullIfNoCoords lets an unresolved coordinate be stored as SQL NULL,
+// keyed off hasCoords rather than f itself — 0 is itself a valid
+// latitude/longitude (null island), so comparing against the float zero
+// value can't distinguish "unresolved" from "resolved to (0, 0)".
+func nullIfNoCoords(f float64, hasCoords bool) interface{} {
+	if !hasCoords {
+		return nil
+	}
+	return f
+}
+
+// getCountryFromAPI resolves ip's location, preferring the local GeoLite2
+// database when one is loaded, then the offline country range table, and
+// falling back to the configured HTTP APIs otherwise. It returns the
+// resolved fields alongside the source that served them, for metrics
+// labeling.
+func (api *GeolocationAPI) getCountryFromAPI(ip string) (IPInfo, string, error) {
+	if api.geoDB != nil {
+		if geo, err := api.geoDB.Lookup(net.ParseIP(ip)); err == nil && geo.Country != "" {
+			return IPInfo{
+				Country:      geo.Country,
+				City:         geo.City,
+				Region:       geo.Region,
+				Latitude:     geo.Latitude,
+				Longitude:    geo.Longitude,
+				hasCoords:    geo.HasCoords,
+				TimeZone:     geo.TimeZone,
+				ASN:          geo.ASN,
+				Organization: geo.Org,
+			}, "geoip", nil
+		} else if err != nil {
+			log.Printf("geoip: local lookup failed, falling back to external API: %v", err)
+		}
+	}
+
+	if api.countryDB != nil {
+		if cc, err := api.countryDB.Lookup(net.ParseIP(ip)); err == nil && cc != "" {
+			return IPInfo{Country: cc}, "range_table", nil
+		}
+	}
+
 	if api.apiKey == "" {
-		return api.getFreeGeoLocation(ip)
+		info, err := api.getFreeGeoLocation(ip)
+		return info, "external_api", err
 	}
 
-	url := fmt.Sprintf("http://api.ipstack.com/%s?access_key=%s", ip, api.apiKey)
+	url := fmt.Sprintf("http://api.ipstack.com/%s?access_key=%s&fields=main,connection", ip, api.apiKey)
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return "", err
+		return IPInfo{}, "external_api", err
 	}
 	defer resp.Body.Close()
 
 	var result IPStackResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return IPInfo{}, "external_api", err
 	}
 
 	if result.CountryName == "" {
-		return "Unknown", nil
+		return IPInfo{Country: "Unknown"}, "external_api", nil
 	}
 
-	return result.CountryName, nil
+	info := IPInfo{
+		Country:      result.CountryName,
+		City:         result.City,
+		Region:       result.RegionName,
+		Latitude:     result.Latitude,
+		Longitude:    result.Longitude,
+		hasCoords:    true,
+		Organization: result.Connection.ISP,
+	}
+	if result.Connection.ASN != 0 {
+		info.ASN = fmt.Sprintf("AS%d", result.Connection.ASN)
+	}
+
+	return info, "external_api", nil
 }
 
-func (api *GeolocationAPI) getFreeGeoLocation(ip string) (string, error) {
-	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=country", ip)
+func (api *GeolocationAPI) getFreeGeoLocation(ip string) (IPInfo, error) {
+	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=country,regionName,city,lat,lon,timezone,as,isp", ip)
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return "", err
+		return IPInfo{}, err
 	}
 	defer resp.Body.Close()
 
 	var result map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return IPInfo{}, err
 	}
 
 	country, ok := result["country"].(string)
 	if !ok || country == "" {
-		return "Unknown", nil
+		return IPInfo{Country: "Unknown"}, nil
 	}
 
-	return country, nil
+	asString := func(key string) string {
+		s, _ := result[key].(string)
+		return s
+	}
+	asFloat := func(key string) float64 {
+		f, _ := result[key].(float64)
+		return f
+	}
+
+	return IPInfo{
+		Country:      country,
+		City:         asString("city"),
+		Region:       asString("regionName"),
+		Latitude:     asFloat("lat"),
+		Longitude:    asFloat("lon"),
+		hasCoords:    true,
+		TimeZone:     asString("timezone"),
+		ASN:          asString("as"),
+		Organization: asString("isp"),
+	}, nil
 }
 
 func (api *GeolocationAPI) geolocateBulkIPs(c *gin.Context) {
@@ -303,14 +710,14 @@ func (api *GeolocationAPI) geolocateBulkIPs(c *gin.Context) {
 
 		if info, found := api.getFromCache(ipStr); found {
 			cacheHits.Inc()
-			requestsTotal.WithLabelValues(info.Country, "cache").Inc()
+			requestsTotal.WithLabelValues(info.Country, "cache", c.FullPath()).Inc()
 			results = append(results, *info)
 			continue
 		}
 
 		cacheMisses.Inc()
 
-		country, err := api.getCountryFromAPI(ipStr)
+		info, source, err := api.getCountryFromAPI(ipStr)
 		if err != nil {
 			results = append(results, IPInfo{
 				IP:      ipStr,
@@ -319,25 +726,29 @@ func (api *GeolocationAPI) geolocateBulkIPs(c *gin.Context) {
 			continue
 		}
 
-		info := IPInfo{
-			IP:       ipStr,
-			Country:  country,
-			CachedAt: time.Now(),
-		}
+		info.IP = ipStr
+		info.CachedAt = time.Now()
 
 		if err := api.saveToCache(&info); err != nil {
 			log.Printf("Failed to save to cache: %v", err)
 		}
 
-		requestsTotal.WithLabelValues(country, "external_api").Inc()
+		requestsTotal.WithLabelValues(info.Country, source, c.FullPath()).Inc()
 		results = append(results, info)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"results": results})
+	format := encoder.FromAccept(c.GetHeader("Accept"))
+	renderList(c, http.StatusOK, format, results, gin.H{"results": results})
 }
 
 func (api *GeolocationAPI) getCachedIPs(c *gin.Context) {
-	query := `SELECT ip, country, cached_at FROM ip_locations ORDER BY cached_at DESC LIMIT 1000`
+	format, ok := encoder.FromExt(c.Param("ext"))
+	if !ok {
+		format = encoder.FromAccept(c.GetHeader("Accept"))
+	}
+
+	query := `SELECT ip, country, city, region, latitude, longitude, time_zone, asn, organization, cached_at
+			  FROM ip_locations ORDER BY cached_at DESC LIMIT 1000`
 
 	rows, err := api.db.Query(query)
 	if err != nil {
@@ -348,14 +759,36 @@ func (api *GeolocationAPI) getCachedIPs(c *gin.Context) {
 
 	var results []IPInfo
 	for rows.Next() {
-		var info IPInfo
-		if err := rows.Scan(&info.IP, &info.Country, &info.CachedAt); err != nil {
+		var (
+			info      IPInfo
+			city      sql.NullString
+			region    sql.NullString
+			latitude  sql.NullFloat64
+			longitude sql.NullFloat64
+			timeZone  sql.NullString
+			asn       sql.NullString
+			org       sql.NullString
+		)
+
+		if err := rows.Scan(
+			&info.IP, &info.Country, &city, &region, &latitude, &longitude, &timeZone, &asn, &org, &info.CachedAt,
+		); err != nil {
 			continue
 		}
+
+		info.City = city.String
+		info.Region = region.String
+		info.Latitude = latitude.Float64
+		info.Longitude = longitude.Float64
+		info.hasCoords = latitude.Valid && longitude.Valid
+		info.TimeZone = timeZone.String
+		info.ASN = asn.String
+		info.Organization = org.String
+
 		results = append(results, info)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	renderList(c, http.StatusOK, format, results, gin.H{
 		"cached_ips": results,
 		"count":      len(results),
 	})
@@ -386,6 +819,127 @@ func (api *GeolocationAPI) clearCacheIP(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Cache cleared for IP", "ip": ipStr})
 }
 
+// reloadEndpoints rebuilds the in-memory KD-tree from the endpoints
+// table. It's called after every registration so the tree stays in sync
+// with what's persisted.
+func (api *GeolocationAPI) reloadEndpoints() error {
+	rows, err := api.db.Query(`SELECT name, latitude, longitude FROM endpoints`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var points []kdtree.Point
+	for rows.Next() {
+		var p kdtree.Point
+		if err := rows.Scan(&p.Name, &p.Latitude, &p.Longitude); err != nil {
+			continue
+		}
+		points = append(points, p)
+	}
+
+	tree := kdtree.New(points)
+
+	api.endpointsMu.Lock()
+	api.endpoints = tree
+	api.endpointsMu.Unlock()
+
+	return nil
+}
+
+func (api *GeolocationAPI) registerEndpoints(c *gin.Context) {
+	var request struct {
+		Endpoints []Endpoint `json:"endpoints" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	for _, e := range request.Endpoints {
+		if e.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Endpoint name is required"})
+			return
+		}
+
+		_, err := api.db.Exec(
+			`INSERT INTO endpoints (name, latitude, longitude) VALUES ($1, $2, $3)`,
+			e.Name, e.Latitude, e.Longitude,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register endpoints"})
+			return
+		}
+	}
+
+	if err := api.reloadEndpoints(); err != nil {
+		log.Printf("Failed to rebuild endpoint KD-tree: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"registered": len(request.Endpoints)})
+}
+
+func (api *GeolocationAPI) nearestEndpoints(c *gin.Context) {
+	ipStr := c.Param("ip")
+
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address"})
+		return
+	}
+
+	n := 3
+	if v := c.Query("n"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "n must be a positive integer"})
+			return
+		}
+		n = parsed
+	}
+
+	info, found := api.getFromCache(ipStr)
+	if !found {
+		resolved, source, err := api.getCountryFromAPI(ipStr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get location"})
+			return
+		}
+
+		info = &resolved
+		info.IP = ipStr
+		info.CachedAt = time.Now()
+
+		if err := api.saveToCache(info); err != nil {
+			log.Printf("Failed to save to cache: %v", err)
+		}
+
+		requestsTotal.WithLabelValues(info.Country, source, c.FullPath()).Inc()
+	}
+
+	middleware.SetResolvedCountry(c, info.Country)
+
+	if !info.hasCoords {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No coordinates available for this IP"})
+		return
+	}
+
+	api.endpointsMu.RLock()
+	tree := api.endpoints
+	api.endpointsMu.RUnlock()
+
+	if tree == nil {
+		c.JSON(http.StatusOK, gin.H{"ip": ipStr, "nearest": []kdtree.Point{}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ip":      ipStr,
+		"nearest": tree.Nearest(info.Latitude, info.Longitude, n),
+	})
+}
+
 func (api *GeolocationAPI) clearAllCache(c *gin.Context) {
 	query := `DELETE FROM ip_locations`
 	result, err := api.db.Exec(query)
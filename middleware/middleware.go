@@ -0,0 +1,167 @@
+// Package middleware holds cross-cutting gin middleware for the API:
+// CORS, request-ID propagation, and structured access logging.
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// CORSConfig controls which cross-origin requests the API accepts.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         time.Duration
+}
+
+// CORSConfigFromEnv builds a CORSConfig from CORS_ALLOWED_ORIGINS,
+// CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS (comma-separated) and
+// CORS_MAX_AGE (seconds), falling back to permissive defaults so the API
+// works out of the box behind a browser.
+func CORSConfigFromEnv() CORSConfig {
+	cfg := CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Accept", "X-Request-ID"},
+		MaxAge:         12 * time.Hour,
+	}
+
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		cfg.AllowedOrigins = splitCSV(v)
+	}
+	if v := os.Getenv("CORS_ALLOWED_METHODS"); v != "" {
+		cfg.AllowedMethods = splitCSV(v)
+	}
+	if v := os.Getenv("CORS_ALLOWED_HEADERS"); v != "" {
+		cfg.AllowedHeaders = splitCSV(v)
+	}
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			cfg.MaxAge = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return cfg
+}
+
+func splitCSV(v string) []string {
+	parts := strings.Split(v, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (cfg CORSConfig) originAllowed(origin string) bool {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS applies cfg to every request, answering preflight OPTIONS
+// requests directly instead of passing them on to the route handlers.
+func CORS(cfg CORSConfig) gin.HandlerFunc {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !cfg.originAllowed(origin) {
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Vary", "Origin")
+		c.Header("Access-Control-Allow-Methods", methods)
+		c.Header("Access-Control-Allow-Headers", headers)
+		c.Header("Access-Control-Max-Age", maxAge)
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requestIDKey is the gin context key the resolved request ID is stored
+// under, for other middleware (and handlers) to read back.
+const requestIDKey = "request_id"
+
+// RequestID echoes the incoming X-Request-ID header, or generates a ULID
+// when the client didn't send one, and sets it on the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if id == "" {
+			id = ulid.Make().String()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// RequestIDFromContext returns the request ID RequestID assigned to c, or
+// "" if the middleware wasn't installed.
+func RequestIDFromContext(c *gin.Context) string {
+	id, _ := c.Get(requestIDKey)
+	s, _ := id.(string)
+	return s
+}
+
+// countryKey is the gin context key handlers store the resolved country
+// under, so AccessLog can include it without re-resolving the IP.
+const countryKey = "resolved_country"
+
+// SetResolvedCountry records the country a handler resolved for the
+// current request, for AccessLog to report.
+func SetResolvedCountry(c *gin.Context, country string) {
+	c.Set(countryKey, country)
+}
+
+// AccessLog emits one structured JSON line per request to logger,
+// recording method, path, client IP, status, latency, response size,
+// request ID, and the resolved country (when a handler set one via
+// SetResolvedCountry).
+func AccessLog(logger zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		defer func() {
+			country, _ := c.Get(countryKey)
+			countryStr, _ := country.(string)
+
+			logger.Info().
+				Str("method", c.Request.Method).
+				Str("path", c.FullPath()).
+				Str("client_ip", c.ClientIP()).
+				Int("status", c.Writer.Status()).
+				Dur("latency", time.Since(start)).
+				Int("bytes", c.Writer.Size()).
+				Str("request_id", RequestIDFromContext(c)).
+				Str("country", countryStr).
+				Msg("request")
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(cfg CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	v1 := r.Group("/api/v1")
+	v1.Use(CORS(cfg))
+	v1.OPTIONS("/*any", func(c *gin.Context) {})
+	v1.POST("/geolocate/bulk", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	return r
+}
+
+// TestCORSPreflight exercises an actual cross-origin preflight request
+// end to end (including gin's routing), since the OPTIONS method isn't
+// reachable at all unless some route registers it.
+func TestCORSPreflight(t *testing.T) {
+	r := newTestRouter(CORSConfigFromEnv())
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/geolocate/bulk", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, "https://example.com")
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Error("Access-Control-Allow-Methods header missing")
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	r := newTestRouter(CORSConfig{AllowedOrigins: []string{"https://allowed.example"}})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/geolocate/bulk", nil)
+	req.Header.Set("Origin", "https://not-allowed.example")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want empty for disallowed origin", got)
+	}
+}
+
+func TestRequestIDGeneratesWhenAbsent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/x", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/x", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Header().Get("X-Request-ID") == "" {
+		t.Error("X-Request-ID header not set when client sent none")
+	}
+}
+
+func TestRequestIDEchoesIncoming(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/x", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/x", nil)
+	req.Header.Set("X-Request-ID", "client-supplied-id")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Request-ID"); got != "client-supplied-id" {
+		t.Errorf("X-Request-ID = %q, want echoed %q", got, "client-supplied-id")
+	}
+}
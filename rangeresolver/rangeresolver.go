@@ -0,0 +1,194 @@
+// Package rangeresolver resolves IPs to country codes using a compiled,
+// in-memory table of start_ip,end_ip,country_code ranges — the same
+// shape as Tor's geoip file — instead of a binary database format. It's
+// an alternative to the geoip package for deployments that can't use
+// MaxMind's binary format.
+package rangeresolver
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resolver resolves an IP to a country code. *Table implements it, and
+// GeolocationAPI holds the range table behind it. The geoip package's DB
+// (whose Lookup returns a full record) and the HTTP fallback do not
+// implement it; GeolocationAPI calls them directly.
+type Resolver interface {
+	Lookup(ip net.IP) (string, error)
+}
+
+// rangeV4 is an IPv4 range, bounds stored as big-endian uint32.
+type rangeV4 struct {
+	lo, hi uint32
+	cc     string
+}
+
+// rangeV6 is an IPv6 range, bounds stored as 128-bit integers.
+type rangeV6 struct {
+	lo, hi *big.Int
+	cc     string
+}
+
+// Table is a loaded set of CIDR-to-country ranges, split by address
+// family and sorted so lookups can binary search in O(log n).
+type Table struct {
+	v4 []rangeV4
+	v6 []rangeV6
+}
+
+// Load parses a plain-text file of `start_ip,end_ip,country_code` lines
+// (blank lines and lines starting with '#' are ignored) into a Table.
+func Load(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("rangeresolver: opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return parse(f)
+}
+
+func parse(r io.Reader) (*Table, error) {
+	t := &Table{}
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("rangeresolver: line %d: expected 3 fields, got %d", lineNo, len(fields))
+		}
+
+		start, end, cc := strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1]), strings.TrimSpace(fields[2])
+
+		if strings.Contains(start, ":") {
+			lo, hi, err := parseV6Bounds(start, end)
+			if err != nil {
+				return nil, fmt.Errorf("rangeresolver: line %d: %w", lineNo, err)
+			}
+			t.v6 = append(t.v6, rangeV6{lo: lo, hi: hi, cc: cc})
+			continue
+		}
+
+		lo, hi, err := parseV4Bounds(start, end)
+		if err != nil {
+			return nil, fmt.Errorf("rangeresolver: line %d: %w", lineNo, err)
+		}
+		t.v4 = append(t.v4, rangeV4{lo: lo, hi: hi, cc: cc})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(t.v4, func(i, j int) bool { return t.v4[i].lo < t.v4[j].lo })
+	sort.Slice(t.v6, func(i, j int) bool { return t.v6[i].lo.Cmp(t.v6[j].lo) < 0 })
+
+	return t, nil
+}
+
+// parseV4Bounds accepts either dotted-quad addresses or raw big-endian
+// uint32 values for start/end.
+func parseV4Bounds(start, end string) (uint32, uint32, error) {
+	lo, err := parseV4(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	hi, err := parseV4(end)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lo, hi, nil
+}
+
+func parseV4(s string) (uint32, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			return ipv4ToUint32(v4), nil
+		}
+		return 0, fmt.Errorf("%q is not an IPv4 address", s)
+	}
+
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid IPv4 bound %q: %w", s, err)
+	}
+	return uint32(n), nil
+}
+
+func ipv4ToUint32(ip net.IP) uint32 {
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+// parseV6Bounds accepts either colon-separated addresses or raw
+// hex-expanded 128-bit values for start/end.
+func parseV6Bounds(start, end string) (*big.Int, *big.Int, error) {
+	lo, err := parseV6(start)
+	if err != nil {
+		return nil, nil, err
+	}
+	hi, err := parseV6(end)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lo, hi, nil
+}
+
+func parseV6(s string) (*big.Int, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		if v6 := ip.To16(); v6 != nil {
+			return new(big.Int).SetBytes(v6), nil
+		}
+	}
+
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != 16 {
+		return nil, fmt.Errorf("invalid IPv6 bound %q", s)
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// Lookup finds the country code of the range containing ip, or an error
+// if ip falls outside every loaded range.
+func (t *Table) Lookup(ip net.IP) (string, error) {
+	if v4 := ip.To4(); v4 != nil {
+		return lookupV4(t.v4, ipv4ToUint32(v4))
+	}
+
+	v6 := ip.To16()
+	if v6 == nil {
+		return "", fmt.Errorf("rangeresolver: invalid IP %v", ip)
+	}
+	return lookupV6(t.v6, new(big.Int).SetBytes(v6))
+}
+
+func lookupV4(ranges []rangeV4, addr uint32) (string, error) {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].hi >= addr })
+	if i < len(ranges) && ranges[i].lo <= addr && addr <= ranges[i].hi {
+		return ranges[i].cc, nil
+	}
+	return "", fmt.Errorf("rangeresolver: no range contains address")
+}
+
+func lookupV6(ranges []rangeV6, addr *big.Int) (string, error) {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].hi.Cmp(addr) >= 0 })
+	if i < len(ranges) && ranges[i].lo.Cmp(addr) <= 0 && ranges[i].hi.Cmp(addr) >= 0 {
+		return ranges[i].cc, nil
+	}
+	return "", fmt.Errorf("rangeresolver: no range contains address")
+}
@@ -0,0 +1,123 @@
+package rangeresolver
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseSkipsBlankAndCommentLines(t *testing.T) {
+	r := strings.NewReader("# comment\n\n192.0.2.0,192.0.2.255,US\n")
+
+	table, err := parse(r)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if len(table.v4) != 1 {
+		t.Fatalf("v4 ranges = %d, want 1", len(table.v4))
+	}
+}
+
+func TestParseRejectsMalformedLine(t *testing.T) {
+	r := strings.NewReader("192.0.2.0,192.0.2.255\n")
+
+	if _, err := parse(r); err == nil {
+		t.Fatal("parse: expected an error for a line missing the country code, got nil")
+	}
+}
+
+func TestParseAcceptsIPv6(t *testing.T) {
+	r := strings.NewReader("2001:db8::,2001:db8::ffff,DE\n")
+
+	table, err := parse(r)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if len(table.v6) != 1 {
+		t.Fatalf("v6 ranges = %d, want 1", len(table.v6))
+	}
+}
+
+func mustTable(t *testing.T, contents string) *Table {
+	t.Helper()
+	table, err := parse(strings.NewReader(contents))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return table
+}
+
+func TestLookupV4Boundaries(t *testing.T) {
+	table := mustTable(t, "192.0.2.0,192.0.2.255,US\n198.51.100.0,198.51.100.255,DE\n")
+
+	tests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{"192.0.2.0", "US", false},   // lower bound, inclusive
+		{"192.0.2.255", "US", false}, // upper bound, inclusive
+		{"192.0.2.128", "US", false}, // mid-range
+		{"198.51.100.0", "DE", false},
+		{"192.0.3.0", "", true},   // just past the first range, before the second
+		{"203.0.113.1", "", true}, // outside every range
+	}
+
+	for _, tt := range tests {
+		got, err := table.Lookup(net.ParseIP(tt.ip))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Lookup(%q) = %q, want an error", tt.ip, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", tt.ip, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestLookupV6Boundaries(t *testing.T) {
+	table := mustTable(t, "2001:db8::,2001:db8::ffff,DE\n")
+
+	tests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{"2001:db8::", "DE", false},
+		{"2001:db8::ffff", "DE", false},
+		{"2001:db8::1:0", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := table.Lookup(net.ParseIP(tt.ip))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Lookup(%q) = %q, want an error", tt.ip, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", tt.ip, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestLookupEmptyTable(t *testing.T) {
+	table := &Table{}
+
+	if _, err := table.Lookup(net.ParseIP("192.0.2.1")); err == nil {
+		t.Fatal("Lookup on empty table: expected an error, got nil")
+	}
+}
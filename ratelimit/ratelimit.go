@@ -0,0 +1,241 @@
+// Package ratelimit provides a per-client-IP, requests-per-hour token
+// bucket for the /api/v1 routes, backed either by an in-process LRU
+// cache for single-instance deployments or Redis for horizontally
+// scaled ones.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hashicorp/golang-lru/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	allowedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ip_geolocation_ratelimit_allowed_total",
+		Help: "Total number of requests allowed by the rate limiter",
+	})
+
+	throttledTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ip_geolocation_ratelimit_throttled_total",
+		Help: "Total number of requests rejected by the rate limiter with 429",
+	})
+)
+
+// Limiter decides whether a client identified by key may make another
+// request, returning the configured limit, the remaining quota, and the
+// unix time the window resets.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (allowed bool, limit, remaining int, resetAt int64, err error)
+}
+
+// bucket is a single client's token bucket, refilled once per hour.
+type bucket struct {
+	mu        sync.Mutex
+	remaining int
+	resetAt   time.Time
+}
+
+// LRULimiter keeps one bucket per client IP in an in-process LRU cache,
+// suitable for single-instance deployments.
+type LRULimiter struct {
+	limit   int
+	window  time.Duration
+	buckets *lru.Cache[string, *bucket]
+}
+
+// NewLRULimiter creates an LRULimiter allowing limit requests per hour
+// per client, tracking up to maxClients distinct clients at a time.
+func NewLRULimiter(limit, maxClients int) (*LRULimiter, error) {
+	cache, err := lru.New[string, *bucket](maxClients)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LRULimiter{
+		limit:   limit,
+		window:  time.Hour,
+		buckets: cache,
+	}, nil
+}
+
+func (l *LRULimiter) Allow(_ context.Context, key string) (bool, int, int, int64, error) {
+	now := time.Now()
+
+	b, ok := l.buckets.Get(key)
+	if !ok {
+		b = &bucket{remaining: l.limit, resetAt: now.Add(l.window)}
+		l.buckets.Add(key, b)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.After(b.resetAt) {
+		b.remaining = l.limit
+		b.resetAt = now.Add(l.window)
+	}
+
+	if b.remaining <= 0 {
+		return false, l.limit, 0, b.resetAt.Unix(), nil
+	}
+
+	b.remaining--
+	return true, l.limit, b.remaining, b.resetAt.Unix(), nil
+}
+
+// RedisLimiter tracks quotas in Redis using INCR/EXPIRE keyed by client
+// IP, suitable for horizontally scaled deployments sharing one limit.
+type RedisLimiter struct {
+	client *redis.Client
+	limit  int
+	window time.Duration
+	prefix string
+}
+
+// NewRedisLimiter creates a RedisLimiter allowing limit requests per hour
+// per client against the given Redis client.
+func NewRedisLimiter(client *redis.Client, limit int) *RedisLimiter {
+	return &RedisLimiter{
+		client: client,
+		limit:  limit,
+		window: time.Hour,
+		prefix: "ratelimit:",
+	}
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string) (bool, int, int, int64, error) {
+	redisKey := r.prefix + key
+
+	count, err := r.client.Incr(ctx, redisKey).Result()
+	if err != nil {
+		return false, r.limit, 0, 0, err
+	}
+
+	if count == 1 {
+		if err := r.client.Expire(ctx, redisKey, r.window).Err(); err != nil {
+			return false, r.limit, 0, 0, err
+		}
+	}
+
+	ttl, err := r.client.TTL(ctx, redisKey).Result()
+	if err != nil {
+		return false, r.limit, 0, 0, err
+	}
+	resetAt := time.Now().Add(ttl).Unix()
+
+	remaining := r.limit - int(count)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return int(count) <= r.limit, r.limit, remaining, resetAt, nil
+}
+
+// ClientIP returns the client IP to rate-limit on. It only trusts xff
+// (the X-Forwarded-For header value, which may be a comma-separated
+// chain) when peerIP — the immediate TCP peer — is itself a configured
+// trusted proxy; otherwise a client could bypass its quota entirely by
+// sending an arbitrary X-Forwarded-For value. When xff isn't trusted (or
+// is absent), peerIP is used directly.
+func ClientIP(xff, peerIP string, trustedProxies *Whitelist) string {
+	if xff == "" || !trustedProxies.Contains(net.ParseIP(peerIP)) {
+		return peerIP
+	}
+
+	for i := 0; i < len(xff); i++ {
+		if xff[i] == ',' {
+			return xff[:i]
+		}
+	}
+	return xff
+}
+
+// Whitelist holds CIDR ranges that bypass rate limiting entirely.
+type Whitelist struct {
+	nets []*net.IPNet
+}
+
+// NewWhitelist parses cidrs into a Whitelist, skipping (and not failing
+// on) malformed entries since this is operator-supplied config.
+func NewWhitelist(cidrs []string) *Whitelist {
+	w := &Whitelist{}
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		w.nets = append(w.nets, n)
+	}
+	return w
+}
+
+// Contains reports whether ip falls within any whitelisted CIDR.
+func (w *Whitelist) Contains(ip net.IP) bool {
+	if w == nil {
+		return false
+	}
+
+	for _, n := range w.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware enforces limiter's quota per client IP, skipping clients
+// within whitelist entirely. trustedProxies gates which immediate peers
+// are allowed to supply X-Forwarded-For at all — without it, any caller
+// could send an arbitrary value and dodge its own quota. It sets
+// X-RateLimit-Limit/-Remaining/-Reset on every rate-limited response and
+// aborts with 429 once the quota is exhausted. Whitelisted clients, and
+// requests let through because the limiter backend returned an error,
+// get no X-RateLimit headers.
+func Middleware(limiter Limiter, whitelist, trustedProxies *Whitelist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		peerIP := c.Request.RemoteAddr
+		if host, _, err := net.SplitHostPort(peerIP); err == nil {
+			peerIP = host
+		}
+
+		clientIP := ClientIP(c.GetHeader("X-Forwarded-For"), peerIP, trustedProxies)
+
+		if whitelist.Contains(net.ParseIP(clientIP)) {
+			c.Next()
+			return
+		}
+
+		allowed, limit, remaining, resetAt, err := limiter.Allow(c.Request.Context(), clientIP)
+		if err != nil {
+			// Fail open: a limiter backend outage shouldn't take the API down.
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(resetAt, 10))
+
+		if !allowed {
+			throttledTotal.Inc()
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": fmt.Sprintf("rate limit of %d requests/hour exceeded", limit),
+			})
+			return
+		}
+
+		allowedTotal.Inc()
+		c.Next()
+	}
+}
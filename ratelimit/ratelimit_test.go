@@ -0,0 +1,30 @@
+package ratelimit
+
+import "testing"
+
+func TestClientIPIgnoresUntrustedXFF(t *testing.T) {
+	trustedProxies := NewWhitelist(nil)
+
+	got := ClientIP("203.0.113.5", "198.51.100.9", trustedProxies)
+	if got != "198.51.100.9" {
+		t.Errorf("ClientIP = %q, want peer IP %q when peer isn't a trusted proxy", got, "198.51.100.9")
+	}
+}
+
+func TestClientIPHonorsXFFFromTrustedProxy(t *testing.T) {
+	trustedProxies := NewWhitelist([]string{"10.0.0.0/8"})
+
+	got := ClientIP("203.0.113.5, 10.0.0.1", "10.0.0.1", trustedProxies)
+	if got != "203.0.113.5" {
+		t.Errorf("ClientIP = %q, want leftmost X-Forwarded-For entry %q", got, "203.0.113.5")
+	}
+}
+
+func TestClientIPFallsBackWhenXFFAbsent(t *testing.T) {
+	trustedProxies := NewWhitelist([]string{"10.0.0.0/8"})
+
+	got := ClientIP("", "10.0.0.1", trustedProxies)
+	if got != "10.0.0.1" {
+		t.Errorf("ClientIP = %q, want peer IP %q", got, "10.0.0.1")
+	}
+}